@@ -0,0 +1,359 @@
+package asche
+
+import (
+	"sync"
+	"unsafe"
+
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// MemoryUsage describes the intended access pattern for an allocation and
+// drives which memory-type the allocator searches for.
+type MemoryUsage int
+
+const (
+	// MemoryUsageGPUOnly requests DEVICE_LOCAL memory with no CPU access,
+	// for render targets and GPU-resident vertex/index/uniform data.
+	MemoryUsageGPUOnly MemoryUsage = iota
+	// MemoryUsageCPUOnly requests HOST_VISIBLE|HOST_COHERENT memory, for
+	// staging buffers the CPU writes and the GPU reads once.
+	MemoryUsageCPUOnly
+	// MemoryUsageCPUToGPU prefers memory that is both DEVICE_LOCAL and
+	// HOST_VISIBLE, falling back to any HOST_VISIBLE memory type.
+	MemoryUsageCPUToGPU
+	// MemoryUsageGPUToCPU requests HOST_VISIBLE|HOST_CACHED memory for
+	// reading GPU-written results back on the CPU.
+	MemoryUsageGPUToCPU
+)
+
+// defaultBlockSize is the size of each vk.DeviceMemory block the allocator
+// requests from the driver; individual allocations are suballocated from it.
+// This keeps us far below the typical maxMemoryAllocationCount limit.
+const defaultBlockSize vk.DeviceSize = 64 * 1024 * 1024
+
+// Allocation is a sub-range of a vk.DeviceMemory block handed out by an
+// Allocator. Buffer/Image is only set by the corresponding Alloc call.
+// MappedPtr is non-nil whenever the backing block lives in a host-visible
+// memory type, in which case the map is kept for the lifetime of the block.
+type Allocation struct {
+	block     *memoryBlock
+	typeIndex uint32
+
+	Buffer    vk.Buffer
+	Image     vk.Image
+	Memory    vk.DeviceMemory
+	Offset    vk.DeviceSize
+	Size      vk.DeviceSize
+	MappedPtr unsafe.Pointer
+}
+
+// freeRange is a [Offset, Offset+Size) hole inside a memoryBlock that is
+// currently available for suballocation.
+type freeRange struct {
+	offset vk.DeviceSize
+	size   vk.DeviceSize
+}
+
+// memoryBlock is a single large vk.DeviceMemory allocation that is carved up
+// into Allocations. free is kept sorted by offset so adjacent ranges can be
+// coalesced in O(n) on release.
+type memoryBlock struct {
+	memory vk.DeviceMemory
+	size   vk.DeviceSize
+	mapped unsafe.Pointer
+	free   []freeRange
+}
+
+// Allocator suballocates vk.DeviceMemory blocks on behalf of Buffer and Image
+// resources, grouping blocks by memory-type index. This avoids the
+// one-allocation-per-resource pattern, which is both slow and bounded by
+// VkPhysicalDeviceLimits.maxMemoryAllocationCount.
+type Allocator struct {
+	device      vk.Device
+	memProps    vk.PhysicalDeviceMemoryProperties
+	granularity vk.DeviceSize
+	blockSize   vk.DeviceSize
+
+	mu           sync.Mutex
+	blocksByType map[uint32][]*memoryBlock
+}
+
+// NewAllocator creates an Allocator for device. bufferImageGranularity should
+// be taken from VkPhysicalDeviceLimits.bufferImageGranularity; it is used to
+// keep buffer and (non-linear) image allocations from sharing a granularity
+// page, as required by the spec.
+func NewAllocator(device vk.Device, memProps vk.PhysicalDeviceMemoryProperties, bufferImageGranularity vk.DeviceSize) *Allocator {
+	return &Allocator{
+		device:       device,
+		memProps:     memProps,
+		granularity:  bufferImageGranularity,
+		blockSize:    defaultBlockSize,
+		blocksByType: make(map[uint32][]*memoryBlock),
+	}
+}
+
+// memoryPropertyFlags maps a MemoryUsage to the device/host requirements
+// passed to FindRequiredMemoryType.
+func memoryPropertyFlags(usage MemoryUsage) (device, host vk.MemoryPropertyFlagBits) {
+	switch usage {
+	case MemoryUsageCPUOnly:
+		return 0, vk.MemoryPropertyHostVisibleBit | vk.MemoryPropertyHostCoherentBit
+	case MemoryUsageCPUToGPU:
+		return vk.MemoryPropertyDeviceLocalBit, vk.MemoryPropertyHostVisibleBit
+	case MemoryUsageGPUToCPU:
+		return 0, vk.MemoryPropertyHostVisibleBit | vk.MemoryPropertyHostCachedBit
+	default: // MemoryUsageGPUOnly
+		return vk.MemoryPropertyDeviceLocalBit, 0
+	}
+}
+
+// findMemoryType resolves a MemoryUsage plus a vk.MemoryRequirements type
+// mask down to a concrete memory-type index, falling back to whatever is
+// available if the preferred flags can't be satisfied.
+func (a *Allocator) findMemoryType(typeBits uint32, usage MemoryUsage) uint32 {
+	deviceReq, hostReq := memoryPropertyFlags(usage)
+	if idx, ok := FindRequiredMemoryType(a.memProps, vk.MemoryPropertyFlagBits(typeBits), deviceReq|hostReq); ok {
+		return idx
+	}
+	idx, _ := FindRequiredMemoryTypeFallback(a.memProps, vk.MemoryPropertyFlagBits(typeBits), hostReq)
+	return idx
+}
+
+// alignUp rounds size up to the nearest multiple of alignment.
+func alignUp(size, alignment vk.DeviceSize) vk.DeviceSize {
+	if alignment == 0 {
+		return size
+	}
+	return (size + alignment - 1) &^ (alignment - 1)
+}
+
+// suballocate finds or carves out a free range of at least size bytes,
+// aligned to alignment, from one of the existing blocks for typeIndex,
+// allocating a fresh block from the driver if none has room.
+func (a *Allocator) suballocate(typeIndex uint32, size, alignment vk.DeviceSize, hostVisible bool) (*memoryBlock, vk.DeviceSize, error) {
+	align := alignment
+	if a.granularity > align {
+		align = a.granularity
+	}
+
+	for _, block := range a.blocksByType[typeIndex] {
+		for i, r := range block.free {
+			offset := alignUp(r.offset, align)
+			end := offset + size
+			if end > r.offset+r.size {
+				continue
+			}
+			a.consumeFreeRange(block, i, r, offset, end)
+			return block, offset, nil
+		}
+	}
+
+	blockSize := a.blockSize
+	if size > blockSize {
+		blockSize = alignUp(size, align)
+	}
+
+	var memory vk.DeviceMemory
+	allocFlags := vk.MemoryAllocateInfo{
+		SType:           vk.StructureTypeMemoryAllocateInfo,
+		AllocationSize:  blockSize,
+		MemoryTypeIndex: typeIndex,
+	}
+	ret := vk.AllocateMemory(a.device, &allocFlags, nil, &memory)
+	if isError(ret) {
+		return nil, 0, newError(ret)
+	}
+
+	block := &memoryBlock{memory: memory, size: blockSize}
+	if hostVisible {
+		var mapped unsafe.Pointer
+		if ret := vk.MapMemory(a.device, memory, 0, blockSize, 0, &mapped); isError(ret) {
+			vk.FreeMemory(a.device, memory, nil)
+			return nil, 0, newError(ret)
+		}
+		block.mapped = mapped
+	}
+	block.free = []freeRange{{offset: 0, size: blockSize}}
+	a.blocksByType[typeIndex] = append(a.blocksByType[typeIndex], block)
+
+	offset := alignUp(0, align)
+	a.consumeFreeRange(block, 0, block.free[0], offset, offset+size)
+	return block, offset, nil
+}
+
+// consumeFreeRange removes [offset, end) from free range i of block,
+// re-inserting whatever padding and trailing space remain.
+func (a *Allocator) consumeFreeRange(block *memoryBlock, i int, r freeRange, offset, end vk.DeviceSize) {
+	remaining := make([]freeRange, 0, len(block.free)+1)
+	remaining = append(remaining, block.free[:i]...)
+	if offset > r.offset {
+		remaining = append(remaining, freeRange{offset: r.offset, size: offset - r.offset})
+	}
+	if end < r.offset+r.size {
+		remaining = append(remaining, freeRange{offset: end, size: r.offset + r.size - end})
+	}
+	remaining = append(remaining, block.free[i+1:]...)
+	block.free = remaining
+}
+
+// release returns [offset, offset+size) to block's free list and coalesces
+// it with any adjacent free ranges.
+func release(block *memoryBlock, offset, size vk.DeviceSize) {
+	inserted := false
+	merged := make([]freeRange, 0, len(block.free)+1)
+	for _, r := range block.free {
+		if !inserted && offset <= r.offset {
+			merged = append(merged, freeRange{offset: offset, size: size})
+			inserted = true
+		}
+		merged = append(merged, r)
+	}
+	if !inserted {
+		merged = append(merged, freeRange{offset: offset, size: size})
+	}
+
+	coalesced := merged[:1]
+	for _, r := range merged[1:] {
+		last := &coalesced[len(coalesced)-1]
+		if last.offset+last.size == r.offset {
+			last.size += r.size
+		} else {
+			coalesced = append(coalesced, r)
+		}
+	}
+	block.free = coalesced
+}
+
+// AllocBuffer creates a vk.Buffer of size bytes with usage and binds it to a
+// suballocated range of a shared vk.DeviceMemory block chosen for memUsage.
+func (a *Allocator) AllocBuffer(size vk.DeviceSize, usage vk.BufferUsageFlagBits, memUsage MemoryUsage) (Allocation, error) {
+	var buffer vk.Buffer
+	ret := vk.CreateBuffer(a.device, &vk.BufferCreateInfo{
+		SType: vk.StructureTypeBufferCreateInfo,
+		Usage: vk.BufferUsageFlags(usage),
+		Size:  size,
+	}, nil, &buffer)
+	if isError(ret) {
+		return Allocation{}, newError(ret)
+	}
+
+	var memReqs vk.MemoryRequirements
+	vk.GetBufferMemoryRequirements(a.device, buffer, &memReqs)
+	memReqs.Deref()
+
+	typeIndex := a.findMemoryType(memReqs.MemoryTypeBits, memUsage)
+
+	a.mu.Lock()
+	a.memProps.MemoryTypes[typeIndex].Deref()
+	hostVisible := vk.MemoryPropertyFlagBits(a.memProps.MemoryTypes[typeIndex].PropertyFlags)&vk.MemoryPropertyHostVisibleBit != 0
+	block, offset, err := a.suballocate(typeIndex, memReqs.Size, memReqs.Alignment, hostVisible)
+	a.mu.Unlock()
+	if err != nil {
+		vk.DestroyBuffer(a.device, buffer, nil)
+		return Allocation{}, err
+	}
+
+	if ret := vk.BindBufferMemory(a.device, buffer, block.memory, offset); isError(ret) {
+		vk.DestroyBuffer(a.device, buffer, nil)
+		return Allocation{}, newError(ret)
+	}
+
+	alloc := Allocation{
+		block:     block,
+		typeIndex: typeIndex,
+		Buffer:    buffer,
+		Memory:    block.memory,
+		Offset:    offset,
+		Size:      memReqs.Size,
+	}
+	if block.mapped != nil {
+		alloc.MappedPtr = unsafe.Pointer(uintptr(block.mapped) + uintptr(offset))
+	}
+	return alloc, nil
+}
+
+// AllocImage creates a vk.Image from info and binds it to a suballocated
+// range of a shared vk.DeviceMemory block chosen for memUsage.
+func (a *Allocator) AllocImage(info vk.ImageCreateInfo, memUsage MemoryUsage) (Allocation, error) {
+	info.SType = vk.StructureTypeImageCreateInfo
+
+	var image vk.Image
+	ret := vk.CreateImage(a.device, &info, nil, &image)
+	if isError(ret) {
+		return Allocation{}, newError(ret)
+	}
+
+	var memReqs vk.MemoryRequirements
+	vk.GetImageMemoryRequirements(a.device, image, &memReqs)
+	memReqs.Deref()
+
+	typeIndex := a.findMemoryType(memReqs.MemoryTypeBits, memUsage)
+
+	a.mu.Lock()
+	a.memProps.MemoryTypes[typeIndex].Deref()
+	hostVisible := vk.MemoryPropertyFlagBits(a.memProps.MemoryTypes[typeIndex].PropertyFlags)&vk.MemoryPropertyHostVisibleBit != 0
+	block, offset, err := a.suballocate(typeIndex, memReqs.Size, memReqs.Alignment, hostVisible)
+	a.mu.Unlock()
+	if err != nil {
+		vk.DestroyImage(a.device, image, nil)
+		return Allocation{}, err
+	}
+
+	if ret := vk.BindImageMemory(a.device, image, block.memory, offset); isError(ret) {
+		vk.DestroyImage(a.device, image, nil)
+		return Allocation{}, newError(ret)
+	}
+
+	alloc := Allocation{
+		block:     block,
+		typeIndex: typeIndex,
+		Image:     image,
+		Memory:    block.memory,
+		Offset:    offset,
+		Size:      memReqs.Size,
+	}
+	if block.mapped != nil {
+		alloc.MappedPtr = unsafe.Pointer(uintptr(block.mapped) + uintptr(offset))
+	}
+	return alloc, nil
+}
+
+// Free destroys alloc's Buffer/Image (whichever is set) and returns its
+// backing range to the block it came from, coalescing with neighboring free
+// ranges. The underlying vk.DeviceMemory block itself is kept around for
+// reuse by future allocations of the same memory type.
+func (a *Allocator) Free(alloc Allocation) {
+	if alloc.Buffer != vk.NullBuffer {
+		vk.DestroyBuffer(a.device, alloc.Buffer, nil)
+	}
+	if alloc.Image != vk.NullImage {
+		vk.DestroyImage(a.device, alloc.Image, nil)
+	}
+	if alloc.block == nil {
+		return
+	}
+
+	a.mu.Lock()
+	release(alloc.block, alloc.Offset, alloc.Size)
+	a.mu.Unlock()
+}
+
+// Destroy unmaps and frees every vk.DeviceMemory block the Allocator has
+// ever requested from the driver. Callers must first Free every Allocation
+// handed out (or destroy the Buffer/Image resources bound to them), since
+// this only releases the blocks themselves, not resources still bound to
+// them. The Allocator must not be used again afterwards.
+func (a *Allocator) Destroy() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for typeIndex, blocks := range a.blocksByType {
+		for _, block := range blocks {
+			if block.mapped != nil {
+				vk.UnmapMemory(a.device, block.memory)
+			}
+			vk.FreeMemory(a.device, block.memory, nil)
+		}
+		delete(a.blocksByType, typeIndex)
+	}
+}
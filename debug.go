@@ -0,0 +1,159 @@
+package asche
+
+import (
+	"log"
+	"unsafe"
+
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// DebugMessageSeverity mirrors VkDebugUtilsMessageSeverityFlagBitsEXT.
+type DebugMessageSeverity vk.DebugUtilsMessageSeverityFlagBitsEXT
+
+// DebugMessageType mirrors VkDebugUtilsMessageTypeFlagBitsEXT.
+type DebugMessageType vk.DebugUtilsMessageTypeFlagBitsEXT
+
+// DebugCallback receives decoded VK_EXT_debug_utils messages. If
+// EnableDebugUtils is called with a nil callback, messages are routed
+// through Go's log package instead.
+type DebugCallback func(severity DebugMessageSeverity, typ DebugMessageType, message string)
+
+// DebugMessenger owns a VkDebugUtilsMessengerEXT and keeps its Go callback
+// alive for the lifetime of the messenger.
+type DebugMessenger struct {
+	instance  vk.Instance
+	messenger vk.DebugUtilsMessengerEXT
+	callback  vk.PFN_vkDebugUtilsMessengerCallbackEXT
+}
+
+// EnableDebugUtils creates a VkDebugUtilsMessengerEXT on instance, routing
+// every message whose severity is in severity and whose type is in types
+// through callback. If callback is nil, messages are logged via Go's log
+// package with a level derived from severity. instance must have been
+// created with VK_EXT_debug_utils in its enabled extensions; see
+// RequiredInstanceExtensions for appending it automatically whenever
+// validation layers are requested.
+func EnableDebugUtils(instance vk.Instance, severity DebugMessageSeverity, types DebugMessageType,
+	callback DebugCallback) (*DebugMessenger, error) {
+
+	if callback == nil {
+		callback = logDebugMessage
+	}
+
+	dm := &DebugMessenger{instance: instance}
+	// Each EnableDebugUtils call builds its own closure over callback and
+	// hands it to CreateDebugUtilsMessengerEXT directly, on the assumption
+	// that vulkan-go's PFN_vkDebugUtilsMessengerCallbackEXT binding accepts
+	// an arbitrary per-call Go function rather than routing through one
+	// registered package-level callback. This has not been exercised
+	// against a real instance with validation layers enabled; verify that
+	// assumption (and this whole messenger path) the first time this runs
+	// against the real dependency.
+	dm.callback = func(
+		messageSeverity vk.DebugUtilsMessageSeverityFlagBitsEXT,
+		messageTypes vk.DebugUtilsMessageTypeFlagsEXT,
+		pCallbackData *vk.DebugUtilsMessengerCallbackDataEXT,
+		pUserData unsafe.Pointer,
+	) vk.Bool32 {
+		pCallbackData.Deref()
+		callback(DebugMessageSeverity(messageSeverity), DebugMessageType(messageTypes), pCallbackData.PMessage)
+		return vk.False
+	}
+
+	ret := vk.CreateDebugUtilsMessengerEXT(instance, &vk.DebugUtilsMessengerCreateInfoEXT{
+		SType:           vk.StructureTypeDebugUtilsMessengerCreateInfoExt,
+		MessageSeverity: vk.DebugUtilsMessageSeverityFlagsEXT(severity),
+		MessageType:     vk.DebugUtilsMessageTypeFlagsEXT(types),
+		PfnUserCallback: dm.callback,
+	}, nil, &dm.messenger)
+	if isError(ret) {
+		return nil, newError(ret)
+	}
+	return dm, nil
+}
+
+// Destroy tears down the underlying VkDebugUtilsMessengerEXT.
+func (dm *DebugMessenger) Destroy() {
+	if dm == nil || dm.messenger == vk.NullDebugUtilsMessengerEXT {
+		return
+	}
+	vk.DestroyDebugUtilsMessengerEXT(dm.instance, dm.messenger, nil)
+	dm.messenger = vk.NullDebugUtilsMessengerEXT
+}
+
+// logDebugMessage is the default DebugCallback, used when EnableDebugUtils is
+// called with callback == nil.
+func logDebugMessage(severity DebugMessageSeverity, typ DebugMessageType, message string) {
+	log.Printf("vulkan debug [%s]: %s", severityString(severity), message)
+}
+
+func severityString(severity DebugMessageSeverity) string {
+	switch {
+	case severity&DebugMessageSeverity(vk.DebugUtilsMessageSeverityErrorBitExt) != 0:
+		return "error"
+	case severity&DebugMessageSeverity(vk.DebugUtilsMessageSeverityWarningBitExt) != 0:
+		return "warning"
+	case severity&DebugMessageSeverity(vk.DebugUtilsMessageSeverityInfoBitExt) != 0:
+		return "info"
+	default:
+		return "verbose"
+	}
+}
+
+// SetObjectName attaches a human-readable name to a Vulkan handle for use in
+// validation messages and external debuggers
+// (vkSetDebugUtilsObjectNameEXT).
+func SetObjectName(device vk.Device, handleType vk.ObjectType, handle uint64, name string) error {
+	ret := vk.SetDebugUtilsObjectNameEXT(device, &vk.DebugUtilsObjectNameInfoEXT{
+		SType:        vk.StructureTypeDebugUtilsObjectNameInfoExt,
+		ObjectType:   handleType,
+		ObjectHandle: handle,
+		PObjectName:  name,
+	})
+	if isError(ret) {
+		return newError(ret)
+	}
+	return nil
+}
+
+// CmdBeginDebugLabel opens a named, colored debug label region on cmd,
+// visible in external debuggers such as RenderDoc.
+func CmdBeginDebugLabel(cmd vk.CommandBuffer, name string, color [4]float32) {
+	vk.CmdBeginDebugUtilsLabelEXT(cmd, &vk.DebugUtilsLabelEXT{
+		SType:      vk.StructureTypeDebugUtilsLabelExt,
+		PLabelName: name,
+		Color:      color,
+	})
+}
+
+// CmdEndDebugLabel closes the most recently opened CmdBeginDebugLabel region
+// on cmd.
+func CmdEndDebugLabel(cmd vk.CommandBuffer) {
+	vk.CmdEndDebugUtilsLabelEXT(cmd)
+}
+
+// CmdInsertDebugLabel inserts a single named, colored marker into cmd
+// without opening a region.
+func CmdInsertDebugLabel(cmd vk.CommandBuffer, name string, color [4]float32) {
+	vk.CmdInsertDebugUtilsLabelEXT(cmd, &vk.DebugUtilsLabelEXT{
+		SType:      vk.StructureTypeDebugUtilsLabelExt,
+		PLabelName: name,
+		Color:      color,
+	})
+}
+
+// RequiredInstanceExtensions appends VK_EXT_debug_utils to extensions
+// whenever validationEnabled is true and the extension isn't already
+// present. The bootstrap should call this on the result of
+// InstanceExtensions whenever validation layers are requested.
+func RequiredInstanceExtensions(extensions []string, validationEnabled bool) []string {
+	if !validationEnabled {
+		return extensions
+	}
+	for _, ext := range extensions {
+		if ext == "VK_EXT_debug_utils" {
+			return extensions
+		}
+	}
+	return append(extensions, "VK_EXT_debug_utils")
+}
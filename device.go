@@ -0,0 +1,255 @@
+package asche
+
+import (
+	"fmt"
+	"reflect"
+
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// QueueCapability is a bitmask of the queue operations a caller needs from a
+// device, used to drive queue-family discovery in ChoosePhysicalDevice.
+type QueueCapability uint32
+
+const (
+	QueueCapabilityGraphics QueueCapability = 1 << iota
+	QueueCapabilityCompute
+	QueueCapabilityTransfer
+	QueueCapabilityPresent
+)
+
+// DeviceRequirements describes what ChoosePhysicalDevice needs from a
+// candidate physical device in order to accept it.
+type DeviceRequirements struct {
+	// RequiredExtensions must all be present in DeviceExtensions(gpu).
+	RequiredExtensions []string
+	// RequiredFeatures are tested against vkGetPhysicalDeviceFeatures; only
+	// fields set to vk.True are checked.
+	RequiredFeatures vk.PhysicalDeviceFeatures
+	// MinAPIVersion is the minimum VkPhysicalDeviceProperties.ApiVersion
+	// accepted, encoded with vk.MakeVersion.
+	MinAPIVersion uint32
+	// PreferredType biases scoring towards a particular vk.PhysicalDeviceType;
+	// it is not a hard requirement.
+	PreferredType vk.PhysicalDeviceType
+	// Queues is the set of queue operations the caller needs available,
+	// combined across one or more queue families.
+	Queues QueueCapability
+}
+
+// QueueFamilies holds the queue-family indices resolved for a physical
+// device against a set of DeviceRequirements. Present is only valid when
+// QueueCapabilityPresent was requested. Transfer is a queue family dedicated
+// to transfer (no graphics/compute) when one exists, and otherwise the
+// Graphics family, which asche's command pools can also use for transfers.
+type QueueFamilies struct {
+	Graphics int
+	Compute  int
+	Transfer int
+	Present  int
+}
+
+// ChoosePhysicalDevice enumerates the physical devices visible to instance,
+// filters out any that fail requirements (missing extensions/features, API
+// version too low, no swapchain-compatible surface support, or queue
+// families that can't cover requirements.Queues), scores the survivors, and
+// returns the highest scoring device along with its resolved queue-family
+// indices. Scoring favors requirements.PreferredType and the presence of a
+// queue family dedicated to transfer.
+func ChoosePhysicalDevice(instance vk.Instance, surface vk.Surface, requirements DeviceRequirements) (vk.PhysicalDevice, QueueFamilies, error) {
+	var count uint32
+	ret := vk.EnumeratePhysicalDevices(instance, &count, nil)
+	if isError(ret) {
+		return nil, QueueFamilies{}, newError(ret)
+	}
+	if count == 0 {
+		return nil, QueueFamilies{}, fmt.Errorf("vulkan: no physical devices found")
+	}
+	gpus := make([]vk.PhysicalDevice, count)
+	ret = vk.EnumeratePhysicalDevices(instance, &count, gpus)
+	if isError(ret) {
+		return nil, QueueFamilies{}, newError(ret)
+	}
+
+	var (
+		best      vk.PhysicalDevice
+		bestScore = -1
+		bestFams  QueueFamilies
+	)
+	for _, gpu := range gpus {
+		fams, ok := resolveQueueFamilies(gpu, surface, requirements.Queues)
+		if !ok {
+			continue
+		}
+		if !deviceSupportsRequirements(gpu, requirements) {
+			continue
+		}
+
+		score := scorePhysicalDevice(gpu, fams, requirements)
+		if score > bestScore {
+			best = gpu
+			bestScore = score
+			bestFams = fams
+		}
+	}
+
+	if best == nil {
+		return nil, QueueFamilies{}, fmt.Errorf("vulkan: no physical device satisfies requirements")
+	}
+	return best, bestFams, nil
+}
+
+// deviceSupportsRequirements checks extensions, features, and API version;
+// queue-family and surface-support checks happen in resolveQueueFamilies.
+func deviceSupportsRequirements(gpu vk.PhysicalDevice, requirements DeviceRequirements) bool {
+	var props vk.PhysicalDeviceProperties
+	vk.GetPhysicalDeviceProperties(gpu, &props)
+	props.Deref()
+	if requirements.MinAPIVersion != 0 && props.ApiVersion < requirements.MinAPIVersion {
+		return false
+	}
+
+	if len(requirements.RequiredExtensions) > 0 {
+		available, err := DeviceExtensions(gpu)
+		if err != nil {
+			return false
+		}
+		have := make(map[string]bool, len(available))
+		for _, ext := range available {
+			have[ext] = true
+		}
+		for _, ext := range requirements.RequiredExtensions {
+			if !have[ext] {
+				return false
+			}
+		}
+	}
+
+	var features vk.PhysicalDeviceFeatures
+	vk.GetPhysicalDeviceFeatures(gpu, &features)
+	features.Deref()
+	if !featuresSatisfy(features, requirements.RequiredFeatures) {
+		return false
+	}
+
+	return true
+}
+
+// featuresSatisfy reports whether every field set to vk.True in required is
+// also vk.True in have. It walks every field of vk.PhysicalDeviceFeatures via
+// reflection so newly added feature bits don't need a matching code change
+// here.
+func featuresSatisfy(have, required vk.PhysicalDeviceFeatures) bool {
+	have.Deref()
+	required.Deref()
+
+	haveVal := reflect.ValueOf(have)
+	reqVal := reflect.ValueOf(required)
+	for i := 0; i < reqVal.NumField(); i++ {
+		reqField := reqVal.Field(i)
+		if reqField.Kind() != reflect.Uint32 {
+			continue
+		}
+		if vk.Bool32(reqField.Uint()) == vk.True && vk.Bool32(haveVal.Field(i).Uint()) != vk.True {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveQueueFamilies finds queue-family indices on gpu covering wanted. It
+// prefers a queue family dedicated to transfer (graphics/compute bits
+// clear) for Transfer, falling back to the graphics family, and returns
+// ok == false if any requested capability can't be satisfied.
+func resolveQueueFamilies(gpu vk.PhysicalDevice, surface vk.Surface, wanted QueueCapability) (QueueFamilies, bool) {
+	var count uint32
+	vk.GetPhysicalDeviceQueueFamilyProperties(gpu, &count, nil)
+	families := make([]vk.QueueFamilyProperties, count)
+	vk.GetPhysicalDeviceQueueFamilyProperties(gpu, &count, families)
+
+	fams := QueueFamilies{Graphics: -1, Compute: -1, Transfer: -1, Present: -1}
+
+	for i := range families {
+		families[i].Deref()
+		flags := vk.QueueFlagBits(families[i].QueueFlags)
+
+		if flags&vk.QueueGraphicsBit != 0 && fams.Graphics == -1 {
+			fams.Graphics = i
+		}
+		if flags&vk.QueueComputeBit != 0 && fams.Compute == -1 {
+			fams.Compute = i
+		}
+		if flags&(vk.QueueGraphicsBit|vk.QueueComputeBit) == 0 && flags&vk.QueueTransferBit != 0 && fams.Transfer == -1 {
+			fams.Transfer = i
+		}
+
+		if wanted&QueueCapabilityPresent != 0 && fams.Present == -1 {
+			var supported vk.Bool32
+			vk.GetPhysicalDeviceSurfaceSupport(gpu, uint32(i), surface, &supported)
+			if supported.B() {
+				fams.Present = i
+			}
+		}
+	}
+
+	if fams.Transfer == -1 {
+		fams.Transfer = fams.Graphics
+	}
+
+	if wanted&QueueCapabilityGraphics != 0 && fams.Graphics == -1 {
+		return fams, false
+	}
+	if wanted&QueueCapabilityCompute != 0 && fams.Compute == -1 {
+		return fams, false
+	}
+	if wanted&QueueCapabilityTransfer != 0 && fams.Transfer == -1 {
+		return fams, false
+	}
+	if wanted&QueueCapabilityPresent != 0 && (fams.Present == -1 || !surfaceHasAdequateSupport(gpu, surface)) {
+		return fams, false
+	}
+	return fams, true
+}
+
+// surfaceHasAdequateSupport reports whether gpu exposes at least one surface
+// format and one present mode for surface, the minimum needed for a usable
+// swapchain.
+func surfaceHasAdequateSupport(gpu vk.PhysicalDevice, surface vk.Surface) bool {
+	var formatCount uint32
+	vk.GetPhysicalDeviceSurfaceFormats(gpu, surface, &formatCount, nil)
+	if formatCount == 0 {
+		return false
+	}
+
+	var presentModeCount uint32
+	vk.GetPhysicalDeviceSurfacePresentModes(gpu, surface, &presentModeCount, nil)
+	return presentModeCount > 0
+}
+
+// scorePhysicalDevice ranks a candidate that has already passed
+// deviceSupportsRequirements and resolveQueueFamilies, preferring discrete
+// GPUs, the caller's PreferredType, and a dedicated transfer queue family.
+func scorePhysicalDevice(gpu vk.PhysicalDevice, fams QueueFamilies, requirements DeviceRequirements) int {
+	var props vk.PhysicalDeviceProperties
+	vk.GetPhysicalDeviceProperties(gpu, &props)
+	props.Deref()
+
+	score := 0
+	switch props.DeviceType {
+	case vk.PhysicalDeviceTypeDiscreteGpu:
+		score += 4000
+	case vk.PhysicalDeviceTypeIntegratedGpu:
+		score += 3000
+	case vk.PhysicalDeviceTypeVirtualGpu:
+		score += 2000
+	case vk.PhysicalDeviceTypeCpu:
+		score += 1000
+	}
+	if requirements.PreferredType != 0 && props.DeviceType == requirements.PreferredType {
+		score += 500
+	}
+	if fams.Transfer != fams.Graphics {
+		score += 100
+	}
+	return score
+}
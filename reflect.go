@@ -0,0 +1,630 @@
+package asche
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// spirvMagicNumber identifies a SPIR-V binary module, see the SPIR-V spec
+// §2.3 "Physical Layout of a SPIR-V Module and Instructions".
+const spirvMagicNumber = 0x07230203
+
+// Minimal subset of SPIR-V opcodes needed for reflection. Values are from
+// the SPIR-V 1.x specification; asche only ever needs to walk a module's
+// type/decoration/variable graph, not execute it.
+const (
+	opName              = 5
+	opMemberName        = 6
+	opExtInstImport     = 11
+	opEntryPoint        = 15
+	opExecutionMode     = 16
+	opTypeVoid          = 19
+	opTypeBool          = 20
+	opTypeInt           = 21
+	opTypeFloat         = 22
+	opTypeVector        = 23
+	opTypeMatrix        = 24
+	opTypeImage         = 25
+	opTypeSampler       = 26
+	opTypeSampledImage  = 27
+	opTypeArray         = 28
+	opTypeRuntimeArray  = 29
+	opTypeStruct        = 30
+	opTypePointer       = 32
+	opConstant          = 43
+	opSpecConstantTrue  = 48
+	opSpecConstantFalse = 49
+	opSpecConstant      = 50
+	opSpecConstantOp    = 52
+	opVariable          = 59
+	opDecorate          = 71
+	opMemberDecorate    = 72
+)
+
+// Decoration values used by reflection; see SPIR-V spec §3.20 "Decoration".
+const (
+	decorationSpecId        = 1
+	decorationBlock         = 2
+	decorationBufferBlock   = 3
+	decorationArrayStride   = 6
+	decorationOffset        = 35
+	decorationBinding       = 33
+	decorationDescriptorSet = 34
+	decorationLocation      = 30
+)
+
+// SPIR-V storage classes relevant to reflection; see spec §3.7.
+const (
+	storageClassUniformConstant = 0
+	storageClassInput           = 1
+	storageClassUniform         = 2
+	storageClassOutput          = 3
+	storageClassPushConstant    = 9
+	storageClassStorageBuffer   = 12
+)
+
+// SPIR-V execution models, mapped to vk.ShaderStageFlagBits.
+var executionModelStage = map[uint32]vk.ShaderStageFlagBits{
+	0: vk.ShaderStageVertexBit,
+	1: vk.ShaderStageTessellationControlBit,
+	2: vk.ShaderStageTessellationEvaluationBit,
+	3: vk.ShaderStageGeometryBit,
+	4: vk.ShaderStageFragmentBit,
+	5: vk.ShaderStageComputeBit,
+}
+
+// PushConstantRange is a merged [Offset, Offset+Size) range within a
+// push-constant block used by a shader stage.
+type PushConstantRange struct {
+	Stage  vk.ShaderStageFlagBits
+	Offset uint32
+	Size   uint32
+}
+
+// DescriptorBinding describes one binding within a descriptor set, as
+// declared by a uniform/storage/sampler variable in the shader.
+//
+// Count is the resolved array length for an arrayed binding (e.g.
+// `sampler2D tex[N]`), taken from the OpConstant backing the array's
+// OpTypeArray length operand, or 1 for a plain (non-array) binding or an
+// unbounded OpTypeRuntimeArray.
+type DescriptorBinding struct {
+	Set     uint32
+	Binding uint32
+	Type    vk.DescriptorType
+	Count   uint32
+	Stage   vk.ShaderStageFlagBits
+}
+
+// VertexInputAttribute describes one Input-storage-class variable consumed
+// by a vertex shader.
+type VertexInputAttribute struct {
+	Location uint32
+	Format   vk.Format
+	Name     string
+}
+
+// SpecializationConstant describes one SpecId-decorated constant, along with
+// the default value baked into the module. Value holds the constant's first
+// 32-bit literal word, so a 64-bit scalar constant's high word is dropped;
+// OpSpecConstantTrue/OpSpecConstantFalse have no literal operand and are
+// reported as 1/0.
+type SpecializationConstant struct {
+	ConstantID uint32
+	Name       string
+	Value      uint32
+}
+
+// ReflectedShader is the result of parsing a SPIR-V module's debug and type
+// information, enough to build descriptor set layouts, pipeline layouts, and
+// vertex input state without hand-mirroring GLSL bindings in Go.
+type ReflectedShader struct {
+	Module     vk.ShaderModule
+	Stage      vk.ShaderStageFlagBits
+	EntryPoint string
+
+	PushConstants []PushConstantRange
+	Descriptors   []DescriptorBinding
+	Inputs        []VertexInputAttribute
+	SpecConstants []SpecializationConstant
+}
+
+// LoadShaderModuleReflect wraps LoadShaderModule and additionally parses
+// data's SPIR-V to extract entry points, push-constant ranges, descriptor
+// bindings, vertex input attributes, and specialization constants.
+func LoadShaderModuleReflect(device vk.Device, data []byte) (*ReflectedShader, error) {
+	module, err := LoadShaderModule(device, data)
+	if err != nil {
+		return nil, err
+	}
+
+	rs, err := reflectSpirv(sliceUint32(data))
+	if err != nil {
+		vk.DestroyShaderModule(device, module, nil)
+		return nil, err
+	}
+	rs.Module = module
+	return rs, nil
+}
+
+// spirvType records just enough about an OpType* instruction to resolve a
+// vertex attribute's vk.Format, a descriptor variable's vk.DescriptorType, or
+// a push-constant block's byte size.
+type spirvType struct {
+	op             uint16
+	componentType  uint32   // OpTypeVector/OpTypeMatrix/OpTypePointer/OpTypeArray: element type id
+	componentCount uint32   // OpTypeVector/OpTypeMatrix/OpTypeArray: component/column/length count
+	width          uint32   // OpTypeInt/OpTypeFloat: bit width
+	signed         uint32   // OpTypeInt: 1 if signed
+	storageClass   uint32   // OpTypePointer
+	sampled        uint32   // OpTypeImage: Sampled operand (1 = sampled, 2 = storage)
+	members        []uint32 // OpTypeStruct: member type ids, in declaration order
+}
+
+func reflectSpirv(words []uint32) (*ReflectedShader, error) {
+	if len(words) < 5 || words[0] != spirvMagicNumber {
+		return nil, fmt.Errorf("vulkan: not a SPIR-V module")
+	}
+
+	rs := &ReflectedShader{}
+
+	types := make(map[uint32]*spirvType)
+	names := make(map[uint32]string)
+	structBlock := make(map[uint32]uint32) // struct type id -> decorationBlock/decorationBufferBlock
+	memberOffsets := make(map[uint32]map[uint32]uint32)
+	arrayStrides := make(map[uint32]uint32)
+	varStorage := make(map[uint32]uint32)
+	varType := make(map[uint32]uint32) // variable id -> pointee type id
+	varBinding := make(map[uint32]uint32)
+	varSet := make(map[uint32]uint32)
+	varLocation := make(map[uint32]uint32)
+	specIDs := make(map[uint32]uint32)
+	constants := make(map[uint32]uint32)
+
+	i := 5
+	for i < len(words) {
+		instr := words[i]
+		wordCount := int(instr >> 16)
+		op := uint16(instr & 0xffff)
+		if wordCount == 0 || i+wordCount > len(words) {
+			break
+		}
+		operands := words[i+1 : i+wordCount]
+
+		switch op {
+		case opEntryPoint:
+			model := operands[0]
+			id := operands[1]
+			entryName := decodeSpirvString(operands[2:])
+			if stage, ok := executionModelStage[model]; ok {
+				rs.Stage = stage
+			}
+			rs.EntryPoint = entryName
+			_ = id
+
+		case opName:
+			names[operands[0]] = decodeSpirvString(operands[1:])
+
+		case opDecorate:
+			target := operands[0]
+			decoration := operands[1]
+			switch decoration {
+			case decorationBinding:
+				varBinding[target] = operands[2]
+			case decorationDescriptorSet:
+				varSet[target] = operands[2]
+			case decorationLocation:
+				varLocation[target] = operands[2]
+			case decorationBlock, decorationBufferBlock:
+				structBlock[target] = decoration
+			case decorationSpecId:
+				specIDs[target] = operands[2]
+			case decorationArrayStride:
+				arrayStrides[target] = operands[2]
+			}
+
+		case opMemberDecorate:
+			structID := operands[0]
+			member := operands[1]
+			decoration := operands[2]
+			if decoration == decorationOffset {
+				if memberOffsets[structID] == nil {
+					memberOffsets[structID] = make(map[uint32]uint32)
+				}
+				memberOffsets[structID][member] = operands[3]
+			}
+
+		case opTypeInt:
+			types[operands[0]] = &spirvType{op: op, width: operands[1], signed: operands[2]}
+		case opTypeFloat:
+			types[operands[0]] = &spirvType{op: op, width: operands[1]}
+		case opTypeVector:
+			types[operands[0]] = &spirvType{op: op, componentType: operands[1], componentCount: operands[2]}
+		case opTypeMatrix:
+			types[operands[0]] = &spirvType{op: op, componentType: operands[1], componentCount: operands[2]}
+		case opTypeStruct:
+			members := append([]uint32(nil), operands[1:]...)
+			types[operands[0]] = &spirvType{op: op, members: members}
+		case opTypeSampledImage, opTypeSampler:
+			types[operands[0]] = &spirvType{op: op}
+		case opTypeImage:
+			t := &spirvType{op: op}
+			if len(operands) > 6 {
+				// Sampled: 1 = used with a separate sampler (read-only sampled
+				// image), 2 = loaded/stored directly (storage image). See
+				// SPIR-V spec §3.32.7 "OpTypeImage".
+				t.sampled = operands[6]
+			}
+			types[operands[0]] = t
+		case opTypeArray, opTypeRuntimeArray:
+			t := &spirvType{op: op, componentType: operands[1]}
+			if op == opTypeArray && len(operands) > 2 {
+				// OpTypeArray's length operand is an <id> referencing the
+				// OpConstant that holds the literal length, not the literal
+				// itself; constants are declared before any type that uses
+				// them, so the lookup below hits for a length given by
+				// OpConstant or OpSpecConstant. A length computed by
+				// OpSpecConstantOp is not recorded and leaves componentCount 0.
+				if length, ok := constants[operands[2]]; ok {
+					t.componentCount = length
+				}
+			}
+			types[operands[0]] = t
+		case opTypePointer:
+			types[operands[0]] = &spirvType{op: op, storageClass: operands[1], componentType: operands[2]}
+
+		case opConstant:
+			resultID := operands[1]
+			if len(operands) > 2 {
+				constants[resultID] = operands[2]
+			}
+
+		case opSpecConstant, opSpecConstantTrue, opSpecConstantFalse:
+			resultID := operands[1]
+			var value uint32
+			switch op {
+			case opSpecConstantTrue:
+				value = 1
+			case opSpecConstant:
+				if len(operands) > 2 {
+					value = operands[2]
+				}
+			}
+			// A spec constant can back an OpTypeArray length just like a
+			// plain OpConstant; record its default value so that case can
+			// resolve a length even when the array is sized by one, falling
+			// back to that default since the actual override is only known
+			// at pipeline-creation time.
+			constants[resultID] = value
+			if id, ok := specIDs[resultID]; ok {
+				rs.SpecConstants = append(rs.SpecConstants, SpecializationConstant{
+					ConstantID: id,
+					Name:       names[resultID],
+					Value:      value,
+				})
+			}
+
+		case opVariable:
+			resultType := operands[0]
+			resultID := operands[1]
+			storageClass := operands[2]
+			varStorage[resultID] = storageClass
+			if t, ok := types[resultType]; ok && t.op == opTypePointer {
+				varType[resultID] = t.componentType
+			}
+		}
+
+		i += wordCount
+	}
+
+	for varID, storage := range varStorage {
+		switch storage {
+		case storageClassInput:
+			if rs.Stage != vk.ShaderStageVertexBit {
+				continue
+			}
+			loc, ok := varLocation[varID]
+			if !ok {
+				continue
+			}
+			format, err := vertexFormatForType(types, varType[varID])
+			if err != nil {
+				return nil, err
+			}
+			rs.Inputs = append(rs.Inputs, VertexInputAttribute{
+				Location: loc,
+				Format:   format,
+				Name:     names[varID],
+			})
+
+		case storageClassPushConstant:
+			typeID, ok := varType[varID]
+			if !ok {
+				continue
+			}
+			size := structSize(types, memberOffsets, arrayStrides, typeID)
+			rs.PushConstants = append(rs.PushConstants, PushConstantRange{
+				Stage:  rs.Stage,
+				Offset: 0,
+				Size:   size,
+			})
+
+		case storageClassUniformConstant, storageClassUniform, storageClassStorageBuffer:
+			typeID := varType[varID]
+			descType, count := descriptorTypeForVariable(types, typeID, storage, structBlock)
+			rs.Descriptors = append(rs.Descriptors, DescriptorBinding{
+				Set:     varSet[varID],
+				Binding: varBinding[varID],
+				Type:    descType,
+				Count:   count,
+				Stage:   rs.Stage,
+			})
+		}
+	}
+
+	return rs, nil
+}
+
+// decodeSpirvString decodes a NUL-terminated, little-endian-packed SPIR-V
+// literal string starting at words[0].
+func decodeSpirvString(words []uint32) string {
+	buf := make([]byte, 0, len(words)*4)
+	for _, w := range words {
+		var b [4]byte
+		binary.LittleEndian.PutUint32(b[:], w)
+		buf = append(buf, b[:]...)
+	}
+	for i, c := range buf {
+		if c == 0 {
+			return string(buf[:i])
+		}
+	}
+	return string(buf)
+}
+
+// vertexFormatForType maps a scalar/vector SPIR-V type to the vk.Format a
+// matching vertex buffer attribute would use, covering 32-bit float, signed
+// int, and unsigned int scalars and vec2/vec3/vec4. It errors out instead of
+// returning vk.FormatUndefined for any type it can't represent (64-bit
+// scalars, bool vectors, etc.), since a caller feeding FormatUndefined into
+// vertex input state would otherwise fail far from the actual cause.
+func vertexFormatForType(types map[uint32]*spirvType, typeID uint32) (vk.Format, error) {
+	t, ok := types[typeID]
+	if !ok {
+		return vk.FormatUndefined, fmt.Errorf("vulkan: unknown vertex input type id %d", typeID)
+	}
+
+	switch t.op {
+	case opTypeFloat:
+		if t.width != 32 {
+			return vk.FormatUndefined, fmt.Errorf("vulkan: unsupported %d-bit float vertex input", t.width)
+		}
+		return vk.FormatR32Sfloat, nil
+
+	case opTypeInt:
+		if t.width != 32 {
+			return vk.FormatUndefined, fmt.Errorf("vulkan: unsupported %d-bit int vertex input", t.width)
+		}
+		if t.signed != 0 {
+			return vk.FormatR32Sint, nil
+		}
+		return vk.FormatR32Uint, nil
+
+	case opTypeVector:
+		comp, ok := types[t.componentType]
+		if !ok {
+			return vk.FormatUndefined, fmt.Errorf("vulkan: unknown vertex input component type id %d", t.componentType)
+		}
+		switch {
+		case comp.op == opTypeFloat && comp.width == 32 && t.componentCount == 2:
+			return vk.FormatR32g32Sfloat, nil
+		case comp.op == opTypeFloat && comp.width == 32 && t.componentCount == 3:
+			return vk.FormatR32g32b32Sfloat, nil
+		case comp.op == opTypeFloat && comp.width == 32 && t.componentCount == 4:
+			return vk.FormatR32g32b32a32Sfloat, nil
+		case comp.op == opTypeInt && comp.width == 32 && comp.signed != 0 && t.componentCount == 2:
+			return vk.FormatR32g32Sint, nil
+		case comp.op == opTypeInt && comp.width == 32 && comp.signed != 0 && t.componentCount == 3:
+			return vk.FormatR32g32b32Sint, nil
+		case comp.op == opTypeInt && comp.width == 32 && comp.signed != 0 && t.componentCount == 4:
+			return vk.FormatR32g32b32a32Sint, nil
+		case comp.op == opTypeInt && comp.width == 32 && comp.signed == 0 && t.componentCount == 2:
+			return vk.FormatR32g32Uint, nil
+		case comp.op == opTypeInt && comp.width == 32 && comp.signed == 0 && t.componentCount == 3:
+			return vk.FormatR32g32b32Uint, nil
+		case comp.op == opTypeInt && comp.width == 32 && comp.signed == 0 && t.componentCount == 4:
+			return vk.FormatR32g32b32a32Uint, nil
+		}
+	}
+	return vk.FormatUndefined, fmt.Errorf("vulkan: unrepresentable vertex input type id %d", typeID)
+}
+
+// structSize walks a struct type's members, using each member's
+// OpMemberDecorate Offset plus its actual type size (via typeSize) to
+// compute the byte extent of the block, rather than assuming a fixed
+// per-member size.
+func structSize(types map[uint32]*spirvType, memberOffsets map[uint32]map[uint32]uint32, arrayStrides map[uint32]uint32, typeID uint32) uint32 {
+	t, ok := types[typeID]
+	if !ok {
+		return 0
+	}
+	offsets := memberOffsets[typeID]
+
+	var size uint32
+	for member, memberType := range t.members {
+		end := offsets[uint32(member)] + typeSize(types, memberOffsets, arrayStrides, memberType)
+		if end > size {
+			size = end
+		}
+	}
+	return size
+}
+
+// typeSize returns the byte size of a SPIR-V type, recursing through
+// vectors, matrices, fixed-length arrays, and nested structs. Arrays use
+// their OpDecorate ArrayStride when present, since std140/std430 rounds an
+// element's stride up to a 16-byte base alignment (e.g. vec3 elements take
+// a 16-byte stride, not the tightly-packed 12); only arrays missing the
+// decoration (which the SPIR-V spec requires for every array type used in
+// a block) fall back to componentCount*elementSize.
+func typeSize(types map[uint32]*spirvType, memberOffsets map[uint32]map[uint32]uint32, arrayStrides map[uint32]uint32, typeID uint32) uint32 {
+	t, ok := types[typeID]
+	if !ok {
+		return 0
+	}
+	switch t.op {
+	case opTypeInt, opTypeFloat:
+		return t.width / 8
+	case opTypeVector, opTypeMatrix:
+		return t.componentCount * typeSize(types, memberOffsets, arrayStrides, t.componentType)
+	case opTypeArray:
+		if stride, ok := arrayStrides[typeID]; ok {
+			return t.componentCount * stride
+		}
+		return t.componentCount * typeSize(types, memberOffsets, arrayStrides, t.componentType)
+	case opTypeStruct:
+		return structSize(types, memberOffsets, arrayStrides, typeID)
+	}
+	return 0
+}
+
+// descriptorTypeForVariable maps a SPIR-V UniformConstant/Uniform/StorageBuffer
+// variable's type to the matching vk.DescriptorType and descriptor count.
+// OpTypeArray/OpTypeRuntimeArray are unwrapped to their element type before
+// classifying, so an arrayed resource (e.g. `sampler2D tex[N]`) reports the
+// element's real DescriptorType instead of falling through to
+// DescriptorTypeUniformBuffer. A fixed-length array's Count comes from its
+// resolved length (see the opTypeArray case in reflectSpirv); a
+// variable-length (runtime) array has no compile-time length and reports 1,
+// leaving the caller to set VkDescriptorSetLayoutBinding.DescriptorCount
+// itself for a true unbounded/bindless binding.
+func descriptorTypeForVariable(types map[uint32]*spirvType, typeID uint32, storage uint32, blocks map[uint32]uint32) (vk.DescriptorType, uint32) {
+	t, ok := types[typeID]
+	if !ok {
+		return vk.DescriptorTypeUniformBuffer, 1
+	}
+	switch t.op {
+	case opTypeArray:
+		elemType, _ := descriptorTypeForVariable(types, t.componentType, storage, blocks)
+		count := t.componentCount
+		if count == 0 {
+			count = 1
+		}
+		return elemType, count
+	case opTypeRuntimeArray:
+		elemType, _ := descriptorTypeForVariable(types, t.componentType, storage, blocks)
+		return elemType, 1
+	case opTypeSampledImage:
+		return vk.DescriptorTypeCombinedImageSampler, 1
+	case opTypeSampler:
+		return vk.DescriptorTypeSampler, 1
+	case opTypeImage:
+		if t.sampled == 1 {
+			return vk.DescriptorTypeSampledImage, 1
+		}
+		return vk.DescriptorTypeStorageImage, 1
+	case opTypeStruct:
+		// SPIR-V 1.0 (the default glslangValidator/glslc vulkan1.0 target)
+		// has no StorageBuffer storage class; an SSBO is instead a
+		// Uniform-storage struct decorated BufferBlock rather than Block.
+		// SPIR-V >=1.3 toolchains emit the StorageBuffer storage class
+		// directly, which is checked here too.
+		if storage == storageClassStorageBuffer || blocks[typeID] == decorationBufferBlock {
+			return vk.DescriptorTypeStorageBuffer, 1
+		}
+		return vk.DescriptorTypeUniformBuffer, 1
+	}
+	return vk.DescriptorTypeUniformBuffer, 1
+}
+
+// BuildPipelineLayout merges the descriptor bindings and push-constant
+// ranges reflected from shaders (as returned by LoadShaderModuleReflect)
+// into a set of compatible VkDescriptorSetLayouts, one per distinct Set
+// index, and a single VkPipelineLayout referencing all of them. Bindings
+// that appear in more than one stage are merged into a single binding with
+// the union of stage flags.
+func BuildPipelineLayout(device vk.Device, shaders ...*ReflectedShader) (vk.PipelineLayout, []vk.DescriptorSetLayout, error) {
+	type bindingKey struct {
+		set     uint32
+		binding uint32
+	}
+	merged := make(map[bindingKey]*DescriptorBinding)
+	var setOrder []uint32
+	seenSet := make(map[uint32]bool)
+
+	for _, shader := range shaders {
+		for _, d := range shader.Descriptors {
+			d := d
+			key := bindingKey{d.Set, d.Binding}
+			if existing, ok := merged[key]; ok {
+				existing.Stage |= d.Stage
+				continue
+			}
+			merged[key] = &d
+			if !seenSet[d.Set] {
+				seenSet[d.Set] = true
+				setOrder = append(setOrder, d.Set)
+			}
+		}
+	}
+
+	layouts := make([]vk.DescriptorSetLayout, 0, len(setOrder))
+	for _, set := range setOrder {
+		var bindings []vk.DescriptorSetLayoutBinding
+		for key, d := range merged {
+			if key.set != set {
+				continue
+			}
+			bindings = append(bindings, vk.DescriptorSetLayoutBinding{
+				Binding:         d.Binding,
+				DescriptorType:  d.Type,
+				DescriptorCount: d.Count,
+				StageFlags:      vk.ShaderStageFlags(d.Stage),
+			})
+		}
+
+		var layout vk.DescriptorSetLayout
+		ret := vk.CreateDescriptorSetLayout(device, &vk.DescriptorSetLayoutCreateInfo{
+			SType:        vk.StructureTypeDescriptorSetLayoutCreateInfo,
+			BindingCount: uint32(len(bindings)),
+			PBindings:    bindings,
+		}, nil, &layout)
+		if isError(ret) {
+			for _, l := range layouts {
+				vk.DestroyDescriptorSetLayout(device, l, nil)
+			}
+			return nil, nil, newError(ret)
+		}
+		layouts = append(layouts, layout)
+	}
+
+	var pushRanges []vk.PushConstantRange
+	for _, shader := range shaders {
+		for _, pc := range shader.PushConstants {
+			pushRanges = append(pushRanges, vk.PushConstantRange{
+				StageFlags: vk.ShaderStageFlags(pc.Stage),
+				Offset:     pc.Offset,
+				Size:       pc.Size,
+			})
+		}
+	}
+
+	var layout vk.PipelineLayout
+	ret := vk.CreatePipelineLayout(device, &vk.PipelineLayoutCreateInfo{
+		SType:                  vk.StructureTypePipelineLayoutCreateInfo,
+		SetLayoutCount:         uint32(len(layouts)),
+		PSetLayouts:            layouts,
+		PushConstantRangeCount: uint32(len(pushRanges)),
+		PPushConstantRanges:    pushRanges,
+	}, nil, &layout)
+	if isError(ret) {
+		for _, l := range layouts {
+			vk.DestroyDescriptorSetLayout(device, l, nil)
+		}
+		return nil, nil, newError(ret)
+	}
+
+	return layout, layouts, nil
+}
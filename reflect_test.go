@@ -0,0 +1,178 @@
+package asche
+
+import (
+	"testing"
+
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// instr packs a SPIR-V instruction's opcode and operand words, computing the
+// word count from len(operands)+1 the way the real binary format requires.
+func instr(op uint16, operands ...uint32) []uint32 {
+	words := make([]uint32, 0, len(operands)+1)
+	wordCount := uint32(len(operands) + 1)
+	words = append(words, (wordCount<<16)|uint32(op))
+	words = append(words, operands...)
+	return words
+}
+
+// spirvModule assembles a minimal SPIR-V module: the 5-word header plus
+// every instruction's words concatenated in order.
+func spirvModule(instrs ...[]uint32) []uint32 {
+	words := []uint32{spirvMagicNumber, 0x00010000, 0, 100, 0}
+	for _, in := range instrs {
+		words = append(words, in...)
+	}
+	return words
+}
+
+func TestReflectSpirv_UniformBuffer(t *testing.T) {
+	const (
+		tFloat   = 1
+		tVec4    = 2
+		tStruct  = 3
+		tPointer = 4
+		vUBO     = 5
+	)
+	words := spirvModule(
+		instr(opTypeFloat, tFloat, 32),
+		instr(opTypeVector, tVec4, tFloat, 4),
+		instr(opTypeStruct, tStruct, tVec4),
+		instr(opTypePointer, tPointer, storageClassUniform, tStruct),
+		instr(opVariable, tPointer, vUBO, storageClassUniform),
+		instr(opDecorate, tStruct, decorationBlock),
+		instr(opDecorate, vUBO, decorationBinding, 0),
+		instr(opDecorate, vUBO, decorationDescriptorSet, 0),
+		instr(opMemberDecorate, tStruct, 0, decorationOffset, 0),
+	)
+
+	rs, err := reflectSpirv(words)
+	if err != nil {
+		t.Fatalf("reflectSpirv: %v", err)
+	}
+	if len(rs.Descriptors) != 1 {
+		t.Fatalf("got %d descriptors, want 1", len(rs.Descriptors))
+	}
+	got := rs.Descriptors[0]
+	if got.Type != vk.DescriptorTypeUniformBuffer {
+		t.Errorf("Type = %v, want DescriptorTypeUniformBuffer", got.Type)
+	}
+	if got.Binding != 0 || got.Set != 0 || got.Count != 1 {
+		t.Errorf("got %+v, want Binding=0 Set=0 Count=1", got)
+	}
+}
+
+func TestReflectSpirv_StorageBufferBlock(t *testing.T) {
+	const (
+		tFloat   = 1
+		tStruct  = 3
+		tPointer = 4
+		vSSBO    = 5
+	)
+	words := spirvModule(
+		instr(opTypeFloat, tFloat, 32),
+		instr(opTypeStruct, tStruct, tFloat),
+		// SPIR-V 1.0 (glslangValidator/glslc's default vulkan1.0 target) has
+		// no StorageBuffer storage class: an SSBO is a Uniform-storage
+		// struct decorated BufferBlock instead of Block.
+		instr(opTypePointer, tPointer, storageClassUniform, tStruct),
+		instr(opVariable, tPointer, vSSBO, storageClassUniform),
+		instr(opDecorate, tStruct, decorationBufferBlock),
+		instr(opDecorate, vSSBO, decorationBinding, 1),
+		instr(opDecorate, vSSBO, decorationDescriptorSet, 0),
+		instr(opMemberDecorate, tStruct, 0, decorationOffset, 0),
+	)
+
+	rs, err := reflectSpirv(words)
+	if err != nil {
+		t.Fatalf("reflectSpirv: %v", err)
+	}
+	if len(rs.Descriptors) != 1 {
+		t.Fatalf("got %d descriptors, want 1", len(rs.Descriptors))
+	}
+	if got := rs.Descriptors[0].Type; got != vk.DescriptorTypeStorageBuffer {
+		t.Errorf("Type = %v, want DescriptorTypeStorageBuffer", got)
+	}
+}
+
+func TestReflectSpirv_ArrayedSampler(t *testing.T) {
+	const (
+		tSampledImage = 1
+		tUint         = 2
+		cLength       = 3
+		tArray        = 4
+		tPointer      = 5
+		vTextures     = 6
+	)
+	words := spirvModule(
+		instr(opTypeSampledImage, tSampledImage),
+		instr(opTypeInt, tUint, 32, 0),
+		instr(opConstant, tUint, cLength, 4),
+		instr(opTypeArray, tArray, tSampledImage, cLength),
+		instr(opTypePointer, tPointer, storageClassUniformConstant, tArray),
+		instr(opVariable, tPointer, vTextures, storageClassUniformConstant),
+		instr(opDecorate, vTextures, decorationBinding, 2),
+		instr(opDecorate, vTextures, decorationDescriptorSet, 0),
+	)
+
+	rs, err := reflectSpirv(words)
+	if err != nil {
+		t.Fatalf("reflectSpirv: %v", err)
+	}
+	if len(rs.Descriptors) != 1 {
+		t.Fatalf("got %d descriptors, want 1", len(rs.Descriptors))
+	}
+	got := rs.Descriptors[0]
+	if got.Type != vk.DescriptorTypeCombinedImageSampler {
+		t.Errorf("Type = %v, want DescriptorTypeCombinedImageSampler", got.Type)
+	}
+	if got.Count != 4 {
+		t.Errorf("Count = %d, want 4", got.Count)
+	}
+}
+
+func TestReflectSpirv_PushConstantVec3Mat3(t *testing.T) {
+	const (
+		tFloat  = 1
+		tVec3   = 2
+		tMat3   = 3
+		tUint   = 4
+		cLength = 5
+		tArray  = 6
+		tStruct = 7
+		tPtr    = 8
+		vPC     = 9
+	)
+	// struct { vec3 lights[4]; mat3 normalMatrix; }, with the array's real
+	// std430 ArrayStride (16, rounded up from vec3's 12-byte size) recorded
+	// explicitly rather than left to be guessed at.
+	words := spirvModule(
+		instr(opTypeFloat, tFloat, 32),
+		instr(opTypeVector, tVec3, tFloat, 3),
+		instr(opTypeMatrix, tMat3, tVec3, 3),
+		instr(opTypeInt, tUint, 32, 0),
+		instr(opConstant, tUint, cLength, 4),
+		instr(opTypeArray, tArray, tVec3, cLength),
+		instr(opTypeStruct, tStruct, tArray, tMat3),
+		instr(opTypePointer, tPtr, storageClassPushConstant, tStruct),
+		instr(opVariable, tPtr, vPC, storageClassPushConstant),
+		instr(opDecorate, tArray, decorationArrayStride, 16),
+		instr(opMemberDecorate, tStruct, 0, decorationOffset, 0),
+		instr(opMemberDecorate, tStruct, 1, decorationOffset, 64),
+	)
+
+	rs, err := reflectSpirv(words)
+	if err != nil {
+		t.Fatalf("reflectSpirv: %v", err)
+	}
+	if len(rs.PushConstants) != 1 {
+		t.Fatalf("got %d push-constant ranges, want 1", len(rs.PushConstants))
+	}
+	// lights: offset 0, size 4*16 (ArrayStride) = 64.
+	// normalMatrix: offset 64, size 3 columns * 12-byte vec3 = 36 (typeSize
+	// doesn't track MatrixStride, only ArrayStride, so this is the packed
+	// lower bound rather than std430's 16-byte-aligned column size) -> 100.
+	if got, want := rs.PushConstants[0].Size, uint32(100); got != want {
+		t.Errorf("Size = %d, want %d", got, want)
+	}
+}
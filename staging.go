@@ -0,0 +1,188 @@
+package asche
+
+import (
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// CreateBufferWithStaging uploads data into a DEVICE_LOCAL buffer suitable
+// for high-throughput vertex/index/uniform access. It allocates a temporary
+// HOST_VISIBLE staging buffer, copies data into it, records a
+// vkCmdCopyBuffer on a transient command buffer from cmdPool, submits it to
+// queue with a fence, waits for completion, and destroys the staging buffer.
+func CreateBufferWithStaging(device vk.Device, allocator *Allocator, queue vk.Queue, cmdPool vk.CommandPool,
+	data []byte, usage vk.BufferUsageFlagBits) (Buffer, error) {
+
+	staging, err := allocator.AllocBuffer(vk.DeviceSize(len(data)), vk.BufferUsageFlagBits(vk.BufferUsageTransferSrcBit), MemoryUsageCPUOnly)
+	if err != nil {
+		return Buffer{}, err
+	}
+	defer allocator.Free(staging)
+
+	if len(data) > 0 && staging.MappedPtr != nil {
+		vk.Memcopy(staging.MappedPtr, data)
+	}
+
+	dst, err := allocator.AllocBuffer(vk.DeviceSize(len(data)),
+		usage|vk.BufferUsageFlagBits(vk.BufferUsageTransferDstBit), MemoryUsageGPUOnly)
+	if err != nil {
+		return Buffer{}, err
+	}
+
+	cmd, err := beginTransientCommandBuffer(device, cmdPool)
+	if err != nil {
+		allocator.Free(dst)
+		return Buffer{}, err
+	}
+	vk.CmdCopyBuffer(cmd, staging.Buffer, dst.Buffer, 1, []vk.BufferCopy{{
+		SrcOffset: 0,
+		DstOffset: 0,
+		Size:      vk.DeviceSize(len(data)),
+	}})
+	if err := endAndSubmitTransientCommandBuffer(device, queue, cmdPool, cmd); err != nil {
+		allocator.Free(dst)
+		return Buffer{}, err
+	}
+
+	return Buffer{
+		device:    device,
+		allocator: allocator,
+		alloc:     dst,
+		Buffer:    dst.Buffer,
+		Memory:    dst.Memory,
+	}, nil
+}
+
+// CreateImageWithStaging uploads data into a DEVICE_LOCAL image via a
+// HOST_VISIBLE staging buffer and a vkCmdCopyBufferToImage, transitioning
+// image from UNDEFINED to dstLayout in the process. image must already be
+// created and bound to device memory (e.g. via Allocator.AllocImage) with
+// usage including VK_IMAGE_USAGE_TRANSFER_DST_BIT.
+func CreateImageWithStaging(device vk.Device, allocator *Allocator, queue vk.Queue, cmdPool vk.CommandPool,
+	data []byte, image vk.Image, width, height uint32, dstLayout vk.ImageLayout) error {
+
+	staging, err := allocator.AllocBuffer(vk.DeviceSize(len(data)), vk.BufferUsageFlagBits(vk.BufferUsageTransferSrcBit), MemoryUsageCPUOnly)
+	if err != nil {
+		return err
+	}
+	defer allocator.Free(staging)
+
+	if len(data) > 0 && staging.MappedPtr != nil {
+		vk.Memcopy(staging.MappedPtr, data)
+	}
+
+	cmd, err := beginTransientCommandBuffer(device, cmdPool)
+	if err != nil {
+		return err
+	}
+
+	ImageMemoryBarrier(cmd, image,
+		0, vk.AccessFlagBits(vk.AccessTransferWriteBit),
+		vk.PipelineStageFlagBits(vk.PipelineStageTopOfPipeBit), vk.PipelineStageFlagBits(vk.PipelineStageTransferBit),
+		vk.ImageLayoutUndefined, vk.ImageLayoutTransferDstOptimal,
+		vk.ImageAspectFlagBits(vk.ImageAspectColorBit))
+
+	vk.CmdCopyBufferToImage(cmd, staging.Buffer, image, vk.ImageLayoutTransferDstOptimal, 1, []vk.BufferImageCopy{{
+		BufferOffset:      0,
+		BufferRowLength:   0,
+		BufferImageHeight: 0,
+		ImageSubresource: vk.ImageSubresourceLayers{
+			AspectMask: vk.ImageAspectFlags(vk.ImageAspectColorBit),
+			LayerCount: 1,
+		},
+		ImageExtent: vk.Extent3D{Width: width, Height: height, Depth: 1},
+	}})
+	ImageMemoryBarrier(cmd, image,
+		vk.AccessFlagBits(vk.AccessTransferWriteBit), vk.AccessFlagBits(vk.AccessShaderReadBit),
+		vk.PipelineStageFlagBits(vk.PipelineStageTransferBit), vk.PipelineStageFlagBits(vk.PipelineStageFragmentShaderBit),
+		vk.ImageLayoutTransferDstOptimal, dstLayout,
+		vk.ImageAspectFlagBits(vk.ImageAspectColorBit))
+
+	return endAndSubmitTransientCommandBuffer(device, queue, cmdPool, cmd)
+}
+
+// BeginBatchUpload returns a command buffer suitable for recording several
+// CmdCopyBuffer/CmdCopyBufferToImage uploads into, so many transfers can be
+// submitted together instead of one fence-wait per upload. The caller
+// submits cmd itself (e.g. via EndBatchUpload) once all uploads are
+// recorded.
+func BeginBatchUpload(device vk.Device, cmdPool vk.CommandPool) (vk.CommandBuffer, error) {
+	return beginTransientCommandBuffer(device, cmdPool)
+}
+
+// EndBatchUpload ends, submits, and waits on a command buffer obtained from
+// BeginBatchUpload, then frees it.
+func EndBatchUpload(device vk.Device, queue vk.Queue, cmdPool vk.CommandPool, cmd vk.CommandBuffer) error {
+	return endAndSubmitTransientCommandBuffer(device, queue, cmdPool, cmd)
+}
+
+// CmdCopyBufferToBuffer records a copy from src to dst into a batch command
+// buffer obtained from BeginBatchUpload, for callers uploading many buffers
+// in one submission.
+func CmdCopyBufferToBuffer(cmd vk.CommandBuffer, src, dst vk.Buffer, size vk.DeviceSize) {
+	vk.CmdCopyBuffer(cmd, src, dst, 1, []vk.BufferCopy{{
+		SrcOffset: 0,
+		DstOffset: 0,
+		Size:      size,
+	}})
+}
+
+// beginTransientCommandBuffer allocates and begins a one-time-submit primary
+// command buffer from cmdPool.
+func beginTransientCommandBuffer(device vk.Device, cmdPool vk.CommandPool) (vk.CommandBuffer, error) {
+	cmdBuffers := make([]vk.CommandBuffer, 1)
+	ret := vk.AllocateCommandBuffers(device, &vk.CommandBufferAllocateInfo{
+		SType:              vk.StructureTypeCommandBufferAllocateInfo,
+		CommandPool:        cmdPool,
+		Level:              vk.CommandBufferLevelPrimary,
+		CommandBufferCount: 1,
+	}, cmdBuffers)
+	if isError(ret) {
+		return nil, newError(ret)
+	}
+	cmd := cmdBuffers[0]
+
+	ret = vk.BeginCommandBuffer(cmd, &vk.CommandBufferBeginInfo{
+		SType: vk.StructureTypeCommandBufferBeginInfo,
+		Flags: vk.CommandBufferUsageFlags(vk.CommandBufferUsageOneTimeSubmitBit),
+	})
+	if isError(ret) {
+		vk.FreeCommandBuffers(device, cmdPool, 1, cmdBuffers)
+		return nil, newError(ret)
+	}
+	return cmd, nil
+}
+
+// endAndSubmitTransientCommandBuffer ends cmd, submits it to queue behind a
+// fence, blocks until the fence signals, then frees cmd and the fence.
+func endAndSubmitTransientCommandBuffer(device vk.Device, queue vk.Queue, cmdPool vk.CommandPool, cmd vk.CommandBuffer) error {
+	cmdBuffers := []vk.CommandBuffer{cmd}
+	defer vk.FreeCommandBuffers(device, cmdPool, 1, cmdBuffers)
+
+	if ret := vk.EndCommandBuffer(cmd); isError(ret) {
+		return newError(ret)
+	}
+
+	var fence vk.Fence
+	ret := vk.CreateFence(device, &vk.FenceCreateInfo{
+		SType: vk.StructureTypeFenceCreateInfo,
+	}, nil, &fence)
+	if isError(ret) {
+		return newError(ret)
+	}
+	defer vk.DestroyFence(device, fence, nil)
+
+	ret = vk.QueueSubmit(queue, 1, []vk.SubmitInfo{{
+		SType:              vk.StructureTypeSubmitInfo,
+		CommandBufferCount: 1,
+		PCommandBuffers:    cmdBuffers,
+	}}, fence)
+	if isError(ret) {
+		return newError(ret)
+	}
+
+	ret = vk.WaitForFences(device, 1, []vk.Fence{fence}, vk.True, vk.MaxUint64)
+	if isError(ret) {
+		return newError(ret)
+	}
+	return nil
+}
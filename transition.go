@@ -0,0 +1,184 @@
+package asche
+
+import (
+	"fmt"
+
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// layoutTransition describes the access/stage masks to use for an
+// ImageMemoryBarrier between two specific image layouts, for the set of
+// transitions TransitionImageLayout knows how to infer.
+type layoutTransition struct {
+	srcAccess vk.AccessFlagBits
+	dstAccess vk.AccessFlagBits
+	srcStage  vk.PipelineStageFlagBits
+	dstStage  vk.PipelineStageFlagBits
+}
+
+// layoutTransitions enumerates the (oldLayout, newLayout) pairs
+// TransitionImageLayout can derive masks for automatically. These mirror the
+// transitions used throughout the vulkan-tutorial texture and depth-buffer
+// chapters.
+var layoutTransitions = map[[2]vk.ImageLayout]layoutTransition{
+	{vk.ImageLayoutUndefined, vk.ImageLayoutTransferDstOptimal}: {
+		srcAccess: 0,
+		dstAccess: vk.AccessFlagBits(vk.AccessTransferWriteBit),
+		srcStage:  vk.PipelineStageFlagBits(vk.PipelineStageTopOfPipeBit),
+		dstStage:  vk.PipelineStageFlagBits(vk.PipelineStageTransferBit),
+	},
+	{vk.ImageLayoutTransferDstOptimal, vk.ImageLayoutShaderReadOnlyOptimal}: {
+		srcAccess: vk.AccessFlagBits(vk.AccessTransferWriteBit),
+		dstAccess: vk.AccessFlagBits(vk.AccessShaderReadBit),
+		srcStage:  vk.PipelineStageFlagBits(vk.PipelineStageTransferBit),
+		dstStage:  vk.PipelineStageFlagBits(vk.PipelineStageFragmentShaderBit),
+	},
+	{vk.ImageLayoutUndefined, vk.ImageLayoutDepthStencilAttachmentOptimal}: {
+		srcAccess: 0,
+		dstAccess: vk.AccessFlagBits(vk.AccessDepthStencilAttachmentReadBit | vk.AccessDepthStencilAttachmentWriteBit),
+		srcStage:  vk.PipelineStageFlagBits(vk.PipelineStageTopOfPipeBit),
+		dstStage:  vk.PipelineStageFlagBits(vk.PipelineStageEarlyFragmentTestsBit),
+	},
+	{vk.ImageLayoutUndefined, vk.ImageLayoutColorAttachmentOptimal}: {
+		srcAccess: 0,
+		dstAccess: vk.AccessFlagBits(vk.AccessColorAttachmentWriteBit),
+		srcStage:  vk.PipelineStageFlagBits(vk.PipelineStageTopOfPipeBit),
+		dstStage:  vk.PipelineStageFlagBits(vk.PipelineStageColorAttachmentOutputBit),
+	},
+	{vk.ImageLayoutColorAttachmentOptimal, vk.ImageLayoutPresentSrc}: {
+		srcAccess: vk.AccessFlagBits(vk.AccessColorAttachmentWriteBit),
+		dstAccess: 0,
+		srcStage:  vk.PipelineStageFlagBits(vk.PipelineStageColorAttachmentOutputBit),
+		dstStage:  vk.PipelineStageFlagBits(vk.PipelineStageBottomOfPipeBit),
+	},
+	{vk.ImageLayoutPresentSrc, vk.ImageLayoutColorAttachmentOptimal}: {
+		srcAccess: 0,
+		dstAccess: vk.AccessFlagBits(vk.AccessColorAttachmentWriteBit),
+		srcStage:  vk.PipelineStageFlagBits(vk.PipelineStageBottomOfPipeBit),
+		dstStage:  vk.PipelineStageFlagBits(vk.PipelineStageColorAttachmentOutputBit),
+	},
+	{vk.ImageLayoutTransferDstOptimal, vk.ImageLayoutTransferSrcOptimal}: {
+		srcAccess: vk.AccessFlagBits(vk.AccessTransferWriteBit),
+		dstAccess: vk.AccessFlagBits(vk.AccessTransferReadBit),
+		srcStage:  vk.PipelineStageFlagBits(vk.PipelineStageTransferBit),
+		dstStage:  vk.PipelineStageFlagBits(vk.PipelineStageTransferBit),
+	},
+}
+
+// TransitionImageLayout records an ImageMemoryBarrier on cmd for the full
+// subresourceRange (so mipmapped/array images are covered in one call),
+// deriving the access and pipeline-stage masks from the (oldLayout,
+// newLayout) pair. It returns an error for layout pairs that aren't in
+// layoutTransitions; callers with an uncommon transition should fall back to
+// ImageMemoryBarrier directly.
+func TransitionImageLayout(cmd vk.CommandBuffer, image vk.Image, oldLayout, newLayout vk.ImageLayout, subresourceRange vk.ImageSubresourceRange) error {
+	t, ok := layoutTransitions[[2]vk.ImageLayout{oldLayout, newLayout}]
+	if !ok {
+		return fmt.Errorf("vulkan: unsupported image layout transition %d -> %d", oldLayout, newLayout)
+	}
+
+	vk.CmdPipelineBarrier(cmd,
+		vk.PipelineStageFlags(t.srcStage),
+		vk.PipelineStageFlags(t.dstStage),
+		vk.False, 0, nil, 0, nil, 1, []vk.ImageMemoryBarrier{{
+			SType:               vk.StructureTypeImageMemoryBarrier,
+			SrcAccessMask:       vk.AccessFlags(t.srcAccess),
+			DstAccessMask:       vk.AccessFlags(t.dstAccess),
+			OldLayout:           oldLayout,
+			NewLayout:           newLayout,
+			SrcQueueFamilyIndex: vk.QueueFamilyIgnored,
+			DstQueueFamilyIndex: vk.QueueFamilyIgnored,
+			Image:               image,
+			SubresourceRange:    subresourceRange,
+		}})
+	return nil
+}
+
+// GenerateMipmaps records the standard blit-per-level loop that derives
+// mipLevels-1 downsampled images from level 0 of image, transitioning each
+// source level to TRANSFER_SRC_OPTIMAL as it's consumed and every level to
+// SHADER_READ_ONLY_OPTIMAL once its blit (or, for the last level, its
+// initial transfer) completes. format is not inspected here; it's part of
+// the signature because format must support linear blitting on the current
+// physical device, and callers are expected to have checked
+// vkGetPhysicalDeviceFormatProperties against it themselves before calling.
+func GenerateMipmaps(cmd vk.CommandBuffer, image vk.Image, format vk.Format, width, height int32, mipLevels uint32) {
+	barrier := vk.ImageMemoryBarrier{
+		SType:               vk.StructureTypeImageMemoryBarrier,
+		Image:               image,
+		SrcQueueFamilyIndex: vk.QueueFamilyIgnored,
+		DstQueueFamilyIndex: vk.QueueFamilyIgnored,
+		SubresourceRange: vk.ImageSubresourceRange{
+			AspectMask: vk.ImageAspectFlags(vk.ImageAspectColorBit),
+			LayerCount: 1,
+			LevelCount: 1,
+		},
+	}
+
+	mipWidth, mipHeight := width, height
+	for level := uint32(1); level < mipLevels; level++ {
+		srcLevel := level - 1
+
+		barrier.SubresourceRange.BaseMipLevel = srcLevel
+		barrier.OldLayout = vk.ImageLayoutTransferDstOptimal
+		barrier.NewLayout = vk.ImageLayoutTransferSrcOptimal
+		barrier.SrcAccessMask = vk.AccessFlags(vk.AccessTransferWriteBit)
+		barrier.DstAccessMask = vk.AccessFlags(vk.AccessTransferReadBit)
+		vk.CmdPipelineBarrier(cmd,
+			vk.PipelineStageFlags(vk.PipelineStageTransferBit), vk.PipelineStageFlags(vk.PipelineStageTransferBit),
+			vk.False, 0, nil, 0, nil, 1, []vk.ImageMemoryBarrier{barrier})
+
+		nextWidth, nextHeight := mipWidth, mipHeight
+		if nextWidth > 1 {
+			nextWidth /= 2
+		}
+		if nextHeight > 1 {
+			nextHeight /= 2
+		}
+
+		vk.CmdBlitImage(cmd,
+			image, vk.ImageLayoutTransferSrcOptimal,
+			image, vk.ImageLayoutTransferDstOptimal,
+			1, []vk.ImageBlit{{
+				SrcSubresource: vk.ImageSubresourceLayers{
+					AspectMask: vk.ImageAspectFlags(vk.ImageAspectColorBit),
+					MipLevel:   srcLevel,
+					LayerCount: 1,
+				},
+				SrcOffsets: [2]vk.Offset3D{
+					{X: 0, Y: 0, Z: 0},
+					{X: mipWidth, Y: mipHeight, Z: 1},
+				},
+				DstSubresource: vk.ImageSubresourceLayers{
+					AspectMask: vk.ImageAspectFlags(vk.ImageAspectColorBit),
+					MipLevel:   level,
+					LayerCount: 1,
+				},
+				DstOffsets: [2]vk.Offset3D{
+					{X: 0, Y: 0, Z: 0},
+					{X: nextWidth, Y: nextHeight, Z: 1},
+				},
+			}}, vk.FilterLinear)
+
+		barrier.OldLayout = vk.ImageLayoutTransferSrcOptimal
+		barrier.NewLayout = vk.ImageLayoutShaderReadOnlyOptimal
+		barrier.SrcAccessMask = vk.AccessFlags(vk.AccessTransferReadBit)
+		barrier.DstAccessMask = vk.AccessFlags(vk.AccessShaderReadBit)
+		vk.CmdPipelineBarrier(cmd,
+			vk.PipelineStageFlags(vk.PipelineStageTransferBit), vk.PipelineStageFlags(vk.PipelineStageFragmentShaderBit),
+			vk.False, 0, nil, 0, nil, 1, []vk.ImageMemoryBarrier{barrier})
+
+		mipWidth, mipHeight = nextWidth, nextHeight
+	}
+
+	// The last mip level was only ever a blit destination, so it still
+	// needs its own transition to SHADER_READ_ONLY_OPTIMAL.
+	barrier.SubresourceRange.BaseMipLevel = mipLevels - 1
+	barrier.OldLayout = vk.ImageLayoutTransferDstOptimal
+	barrier.NewLayout = vk.ImageLayoutShaderReadOnlyOptimal
+	barrier.SrcAccessMask = vk.AccessFlags(vk.AccessTransferWriteBit)
+	barrier.DstAccessMask = vk.AccessFlags(vk.AccessShaderReadBit)
+	vk.CmdPipelineBarrier(cmd,
+		vk.PipelineStageFlags(vk.PipelineStageTransferBit), vk.PipelineStageFlags(vk.PipelineStageFragmentShaderBit),
+		vk.False, 0, nil, 0, nil, 1, []vk.ImageMemoryBarrier{barrier})
+}
@@ -126,73 +126,52 @@ func FindRequiredMemoryTypeFallback(props vk.PhysicalDeviceMemoryProperties,
 type Buffer struct {
 	// device for destroy purposes.
 	device vk.Device
+	// allocator is the Allocator the backing memory was suballocated from.
+	allocator *Allocator
+	// alloc is the suballocated range backing Buffer.
+	alloc Allocation
 	// Buffer is the buffer object.
 	Buffer vk.Buffer
 	// Memory is the device memory backing buffer object.
 	Memory vk.DeviceMemory
 }
 
-func (b Buffer) Destroy() {
-	vk.FreeMemory(b.device, b.Memory, nil)
-	vk.DestroyBuffer(b.device, b.Buffer, nil)
+func (b *Buffer) Destroy() {
+	b.allocator.Free(b.alloc)
 	b.device = nil
+	b.Buffer = vk.NullBuffer
+	b.Memory = vk.NullDeviceMemory
+	b.alloc = Allocation{}
 }
 
-func CreateBuffer(device vk.Device, memProps vk.PhysicalDeviceMemoryProperties,
+// CreateBuffer suballocates a host-visible buffer of len(data) bytes from
+// allocator, copying data into it immediately. See CreateBufferWithStaging
+// for a DEVICE_LOCAL alternative.
+func CreateBuffer(device vk.Device, allocator *Allocator,
 	data []byte, usage vk.BufferUsageFlagBits) Buffer {
 
-	var buffer vk.Buffer
-	var memory vk.DeviceMemory
-	ret := vk.CreateBuffer(device, &vk.BufferCreateInfo{
-		SType: vk.StructureTypeBufferCreateInfo,
-		Usage: vk.BufferUsageFlags(usage),
-		Size:  vk.DeviceSize(len(data)),
-	}, nil, &buffer)
-	orPanic(newError(ret))
-
-	// Ask device about its memory requirements.
-
-	var memReqs vk.MemoryRequirements
-	vk.GetBufferMemoryRequirements(device, buffer, &memReqs)
-	memReqs.Deref()
-
-	memType, ok := FindRequiredMemoryType(memProps, vk.MemoryPropertyFlagBits(memReqs.MemoryTypeBits),
-		vk.MemoryPropertyHostVisibleBit|vk.MemoryPropertyHostCoherentBit)
-	if !ok {
-		log.Println("vulkan warning: failed to find required memory type")
-	}
+	alloc, err := allocator.AllocBuffer(vk.DeviceSize(len(data)), usage, MemoryUsageCPUOnly)
+	orPanic(err)
 
-	// Allocate device memory and bind to the buffer.
-
-	ret = vk.AllocateMemory(device, &vk.MemoryAllocateInfo{
-		SType:           vk.StructureTypeMemoryAllocateInfo,
-		AllocationSize:  memReqs.Size,
-		MemoryTypeIndex: memType,
-	}, nil, &memory)
-	orPanic(newError(ret), func() {
-		vk.DestroyBuffer(device, buffer, nil)
-	})
-	vk.BindBufferMemory(device, buffer, memory, 0)
 	b := Buffer{
-		device: device,
-		Buffer: buffer,
-		Memory: memory,
+		device:    device,
+		allocator: allocator,
+		alloc:     alloc,
+		Buffer:    alloc.Buffer,
+		Memory:    alloc.Memory,
 	}
 
-	// Map the memory and dump data in there.
+	// Dump data into the persistently mapped block.
 
 	if len(data) > 0 {
-		var pData unsafe.Pointer
-		ret := vk.MapMemory(device, memory, 0, vk.DeviceSize(len(data)), 0, &pData)
-		if isError(ret) {
-			log.Printf("vulkan warning: failed to map device memory for data (len=%d)", len(data))
+		if alloc.MappedPtr == nil {
+			log.Printf("vulkan warning: no mapped pointer for data (len=%d)", len(data))
 			return b
 		}
-		n := vk.Memcopy(pData, data)
+		n := vk.Memcopy(alloc.MappedPtr, data)
 		if n != len(data) {
 			log.Printf("vulkan warning: failed to copy data, %d != %d", n, len(data))
 		}
-		vk.UnmapMemory(device, memory)
 	}
 	return b
 }